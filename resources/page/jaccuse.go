@@ -1,83 +1,470 @@
 package page
 
 import (
+   "bytes"
+   _ "embed"
    "encoding/base64"
    "fmt"
+   "image"
+   "image/gif"
+   "io"
    "os"
+   "os/exec"
    "path/filepath"
+   "strings"
    "sync"
    "time"
 )
 
 var jaccuseOnce sync.Once
 
+//go:embed jaccuse_default.gif
+var defaultJaccuseGIF []byte
+
+// JaccuseMode controls whether the J'Accuse shortcode renders an image, the
+// ASCII fallback animation, or nothing at all.
+type JaccuseMode string
+
+const (
+   JaccuseModeAuto  JaccuseMode = "auto"
+   JaccuseModeImage JaccuseMode = "image"
+   JaccuseModeText  JaccuseMode = "text"
+   JaccuseModeOff   JaccuseMode = "off"
+)
+
+// JaccuseConfig is the `jaccuse` site-config section: conf.Jaccuse.AssetPath,
+// conf.Jaccuse.Disabled, conf.Jaccuse.Mode. AssetPath, when set, takes
+// priority over the static/assets lookups and the embedded default.
+//
+// Wiring a real conf.Conf accessor for this section means touching the
+// config package, which isn't part of this change set, so Jaccuse() below
+// uses defaultJaccuseConfig rather than a fake reachable-from-nowhere
+// provider. Tracked as follow-up work, not shipped here.
+type JaccuseConfig struct {
+   AssetPath string
+   Disabled  bool
+   Mode      JaccuseMode
+}
+
+func defaultJaccuseConfig() JaccuseConfig {
+   return JaccuseConfig{Mode: JaccuseModeAuto}
+}
+
 // just: "make the shortcode 'x' throw a warning"
 func (i HugoInfo) Jaccuse() string {
    jaccuseOnce.Do(func() {
-      doJaccuse(i.opts.Conf.WorkingDir())
+      doJaccuse(i.opts.Conf.WorkingDir(), defaultJaccuseConfig())
    })
    return ""
 }
 
-func doJaccuse(workingDir string) {
-   if showJaccuseImage(workingDir) {
+func doJaccuse(workingDir string, cfg JaccuseConfig) {
+   if cfg.Disabled || cfg.Mode == JaccuseModeOff {
+      return
+   }
+   if cfg.Mode != JaccuseModeText && showJaccuseImage(workingDir, cfg) {
+      return
+   }
+   if cfg.Mode == JaccuseModeImage {
       return
    }
    showJaccuseAnimation()
 }
 
-func termSupportsImages() bool {
-   tp := os.Getenv("TERM_PROGRAM")
-   if tp == "iTerm.app" || tp == "WezTerm" || tp == "ghostty" {
-      return true
+// resolveJaccuseAsset returns the GIF to render, trying in order: the
+// configured override, the site's static/ dir, the site's assets/ dir, and
+// finally the embedded default so the shortcode works with no setup at all.
+func resolveJaccuseAsset(workingDir string, cfg JaccuseConfig) io.Reader {
+   var candidates []string
+   if cfg.AssetPath != "" {
+      if filepath.IsAbs(cfg.AssetPath) {
+         candidates = append(candidates, cfg.AssetPath)
+      } else {
+         candidates = append(candidates, filepath.Join(workingDir, cfg.AssetPath))
+      }
+   }
+   candidates = append(candidates,
+      filepath.Join(workingDir, "static", "jaccuse.gif"),
+      filepath.Join(workingDir, "assets", "jaccuse.gif"),
+   )
+
+   for _, p := range candidates {
+      if data, err := os.ReadFile(p); err == nil {
+         return bytes.NewReader(data)
+      }
+   }
+   return bytes.NewReader(defaultJaccuseGIF)
+}
+
+// jaccuseProtocol identifies which terminal image-transfer wire format
+// showJaccuseImage should speak.
+type jaccuseProtocol int
+
+const (
+   protoNone jaccuseProtocol = iota
+   protoITerm
+   protoKonsole
+   protoKitty
+   protoSixel
+)
+
+var (
+   jaccuseProtoOnce sync.Once
+   jaccuseProto     jaccuseProtocol
+
+   jaccuseEncodeOnce sync.Once
+   jaccusePayload    []byte
+   jaccuseEncodeErr  error
+)
+
+// detectJaccuseProtocol probes the environment once per process and caches
+// the result; repeated Jaccuse() runs (in tests, mainly) don't re-probe.
+func detectJaccuseProtocol() jaccuseProtocol {
+   jaccuseProtoOnce.Do(func() {
+      jaccuseProto = probeJaccuseProtocol()
+   })
+   return jaccuseProto
+}
+
+func probeJaccuseProtocol() jaccuseProtocol {
+   switch os.Getenv("TERM_PROGRAM") {
+   case "iTerm.app", "WezTerm", "ghostty":
+      return protoITerm
+   case "Konsole":
+      return protoKonsole
    }
    if os.Getenv("TERM") == "xterm-kitty" {
+      return protoKitty
+   }
+   if termSupportsSixel() {
+      return protoSixel
+   }
+   return protoNone
+}
+
+// termSupportsSixel checks the handful of environment hints that reliably
+// mean Sixel, falling back to an active DA1 device-attributes probe when
+// none of them apply. COLORTERM is deliberately not treated as a signal on
+// its own: it means 24-bit color support, which most VTE-based terminals
+// (GNOME Terminal, Tilix, Terminator) and plain xterm set without ever
+// implementing Sixel, and a false positive here means garbled escape bytes
+// instead of the working ASCII fallback.
+func termSupportsSixel() bool {
+   term := os.Getenv("TERM")
+   if strings.Contains(term, "mlterm") || strings.Contains(term, "foot") {
+      return true
+   }
+   if term == "xterm-256color" && os.Getenv("XTERM_VERSION") != "" {
       return true
    }
-   return false
+   return probeSixelDA1()
 }
 
-func showJaccuseImage(workingDir string) bool {
-   if !termSupportsImages() {
+// probeSixelDA1 sends a primary device attributes query and looks for
+// attribute "4" (Sixel graphics) in the response. It gives up quickly if the
+// terminal never answers, e.g. because stdin/stdout aren't a real tty.
+func probeSixelDA1() bool {
+   restore, err := setStdinRaw()
+   if err != nil {
       return false
    }
+   defer restore()
 
-   gifPath := filepath.Join(workingDir, "static", "jaccuse.gif")
-   data, err := os.ReadFile(gifPath)
-   if err != nil {
+   fmt.Fprint(os.Stdout, "\033[c")
+
+   resp := make(chan string, 1)
+   go func() {
+      buf := make([]byte, 64)
+      n, _ := os.Stdin.Read(buf)
+      resp <- string(buf[:n])
+   }()
+
+   select {
+   case r := <-resp:
+      return strings.Contains(r, ";4;") || strings.Contains(r, ";4c")
+   case <-time.After(200 * time.Millisecond):
       return false
    }
+}
 
-   encoded := base64.StdEncoding.EncodeToString(data)
+// setStdinRaw puts the controlling terminal into raw mode for the duration
+// of a DA1 probe and returns a func that restores it.
+func setStdinRaw() (func(), error) {
+   if err := exec.Command("stty", "-f", "/dev/stdin", "raw", "-echo").Run(); err != nil {
+      if err := exec.Command("stty", "raw", "-echo").Run(); err != nil {
+         return nil, err
+      }
+   }
+   return func() {
+      exec.Command("stty", "sane").Run()
+   }, nil
+}
 
-   tp := os.Getenv("TERM_PROGRAM")
-   if tp == "ghostty" || tp == "iTerm.app" || tp == "WezTerm" {
-      fmt.Fprintf(os.Stderr, "\033]1337;File=inline=1;width=40;preserveAspectRatio=1:%s\a\n", encoded)
-      return true
+func showJaccuseImage(workingDir string, cfg JaccuseConfig) bool {
+   proto := detectJaccuseProtocol()
+   if proto == protoNone {
+      return false
    }
 
-   if os.Getenv("TERM") == "xterm-kitty" {
-      chunk := 4096
-      for i := 0; i < len(encoded); i += chunk {
-         end := i + chunk
-         if end > len(encoded) {
-            end = len(encoded)
-         }
-         m := 1
-         if end >= len(encoded) {
-            m = 0
+   payload, err := jaccuseEncodedPayload(proto, resolveJaccuseAsset(workingDir, cfg))
+   if err != nil {
+      return false
+   }
+
+   tw := newTermWriter(os.Stderr)
+
+   switch proto {
+   case protoITerm:
+      seq := fmt.Sprintf("\033]1337;File=inline=1;width=40;preserveAspectRatio=1:%s\a", payload)
+      if !tw.fitsSingleSeq(len(seq)) {
+         return false
+      }
+      tw.writeSeq(seq)
+      fmt.Fprintf(os.Stderr, "\n")
+   case protoKonsole:
+      seq := fmt.Sprintf("\033]1337;File=inline=1;width=40;preserveAspectRatio=1:%s\033\\", payload)
+      if !tw.fitsSingleSeq(len(seq)) {
+         return false
+      }
+      tw.writeSeq(seq)
+      fmt.Fprintf(os.Stderr, "\n")
+   case protoKitty:
+      writeChunked(tw, string(payload), tw.chunkSize(4096), func(chunk string, first, more bool) string {
+         m := 0
+         if more {
+            m = 1
          }
-         if i == 0 {
-            fmt.Fprintf(os.Stderr, "\033_Gf=100,a=T,m=%d;%s\033\\", m, encoded[i:end])
-         } else {
-            fmt.Fprintf(os.Stderr, "\033_Gm=%d;%s\033\\", m, encoded[i:end])
+         if first {
+            return fmt.Sprintf("\033_Gf=100,a=T,m=%d;%s\033\\", m, chunk)
          }
+         return fmt.Sprintf("\033_Gm=%d;%s\033\\", m, chunk)
+      })
+      fmt.Fprintf(os.Stderr, "\n")
+   case protoSixel:
+      if !tw.fitsSingleSeq(len(payload)) {
+         return false
       }
+      tw.writeSeq(string(payload))
       fmt.Fprintf(os.Stderr, "\n")
+   default:
+      return false
+   }
+
+   return true
+}
+
+// passthroughKind identifies the terminal-multiplexer passthrough envelope
+// (if any) that outbound escape sequences need to be wrapped in so the host
+// terminal, rather than the multiplexer, sees them.
+type passthroughKind int
+
+const (
+   passthroughNone passthroughKind = iota
+   passthroughTmux
+   passthroughScreen
+)
+
+// screenDCSLimit is screen's approximate cap on bytes per DCS string;
+// Kitty's chunk size is shrunk to stay comfortably under it once wrapped.
+const screenDCSLimit = 768
+
+// termWriter writes raw escape sequences to w, transparently wrapping them
+// in the tmux/screen passthrough envelope when running inside a multiplexer
+// so Sixel, Kitty, iTerm2, and Konsole all forward correctly.
+type termWriter struct {
+   w           io.Writer
+   passthrough passthroughKind
+}
+
+func newTermWriter(w io.Writer) *termWriter {
+   return &termWriter{w: w, passthrough: detectPassthrough()}
+}
+
+func detectPassthrough() passthroughKind {
+   if os.Getenv("TMUX") != "" {
+      return passthroughTmux
+   }
+   term := os.Getenv("TERM")
+   if strings.HasPrefix(term, "tmux") {
+      return passthroughTmux
+   }
+   if strings.HasPrefix(term, "screen") {
+      return passthroughScreen
+   }
+   return passthroughNone
+}
+
+// writeSeq writes a single escape sequence, wrapping it in the tmux/screen
+// DCS passthrough envelope (doubling any embedded ESC bytes, as both
+// conventions require) when one applies.
+func (tw *termWriter) writeSeq(seq string) {
+   switch tw.passthrough {
+   case passthroughTmux:
+      fmt.Fprint(tw.w, "\033Ptmux;\033"+strings.ReplaceAll(seq, "\033", "\033\033")+"\033\\")
+   case passthroughScreen:
+      fmt.Fprint(tw.w, "\033P"+strings.ReplaceAll(seq, "\033", "\033\033")+"\033\\")
+   default:
+      fmt.Fprint(tw.w, seq)
+   }
+}
+
+// chunkSize returns the largest chunk a multi-chunk backend (Kitty) should
+// use, shrinking base to fit under screen's per-DCS byte cap once the
+// passthrough envelope's own overhead and ESC-doubling are accounted for.
+func (tw *termWriter) chunkSize(base int) int {
+   if tw.passthrough == passthroughScreen && base > screenDCSLimit/2 {
+      return screenDCSLimit / 2
+   }
+   return base
+}
+
+// fitsSingleSeq reports whether a seqLen-byte sequence can be sent as one
+// DCS-wrapped write. Unlike Kitty's multi-transmission protocol, iTerm2's
+// and Konsole's OSC 1337 and the Sixel body aren't designed to be split
+// across several DCS sequences, so under screen's per-DCS byte cap the
+// caller has to drop the whole sequence rather than send a truncated one.
+func (tw *termWriter) fitsSingleSeq(seqLen int) bool {
+   if tw.passthrough != passthroughScreen {
       return true
    }
+   return seqLen+len("\033P")+len("\033\\") <= screenDCSLimit
+}
+
+// jaccuseEncodedPayload reads asset and encodes it for proto, caching the
+// result so a second shortcode invocation in the same process never
+// re-reads or re-quantizes the image.
+func jaccuseEncodedPayload(proto jaccuseProtocol, asset io.Reader) ([]byte, error) {
+   jaccuseEncodeOnce.Do(func() {
+      data, err := io.ReadAll(asset)
+      if err != nil {
+         jaccuseEncodeErr = err
+         return
+      }
+
+      if proto == protoSixel {
+         jaccusePayload, jaccuseEncodeErr = encodeSixel(bytes.NewReader(data))
+         return
+      }
+
+      jaccusePayload = []byte(base64.StdEncoding.EncodeToString(data))
+   })
+   return jaccusePayload, jaccuseEncodeErr
+}
+
+// writeChunked streams payload through tw in fixed-size chunks, letting the
+// caller supply the per-chunk framing; tw takes care of tmux/screen
+// passthrough wrapping for each chunk.
+func writeChunked(tw *termWriter, payload string, chunkSize int, frame func(chunk string, first, more bool) string) {
+   for i := 0; i < len(payload); i += chunkSize {
+      end := i + chunkSize
+      if end > len(payload) {
+         end = len(payload)
+      }
+      tw.writeSeq(frame(payload[i:end], i == 0, end < len(payload)))
+   }
+}
 
-   return false
+// encodeSixel decodes the first frame of a GIF and renders it as a Sixel DCS
+// body: a palette preamble built from the GIF's own (already <=256 color)
+// palette, followed by one run-length-encoded six-pixel band per color per
+// row group.
+func encodeSixel(r io.Reader) ([]byte, error) {
+   img, err := gif.Decode(r)
+   if err != nil {
+      return nil, fmt.Errorf("jaccuse: decode gif: %w", err)
+   }
+   pal, ok := img.(*image.Paletted)
+   if !ok {
+      return nil, fmt.Errorf("jaccuse: expected a paletted gif frame")
+   }
+
+   var buf bytes.Buffer
+   buf.WriteString("\033Pq")
+
+   for i, c := range pal.Palette {
+      r, g, b, _ := c.RGBA()
+      fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+   }
+
+   bounds := pal.Bounds()
+   width := bounds.Dx()
+
+   for top := bounds.Min.Y; top < bounds.Max.Y; top += 6 {
+      rows := 6
+      if top+rows > bounds.Max.Y {
+         rows = bounds.Max.Y - top
+      }
+      for _, idx := range usedPaletteIndices(pal, top, rows) {
+         fmt.Fprintf(&buf, "#%d", idx)
+         writeSixelBand(&buf, pal, top, rows, width, bounds.Min.X, idx)
+         buf.WriteByte('$')
+      }
+      buf.WriteByte('-')
+   }
+
+   buf.WriteString("\033\\")
+   return buf.Bytes(), nil
+}
+
+// usedPaletteIndices returns, in ascending order, the palette indices that
+// appear anywhere in the [top, top+rows) band, so encodeSixel never emits an
+// empty band for a color that isn't present.
+func usedPaletteIndices(pal *image.Paletted, top, rows int) []int {
+   seen := make(map[int]bool)
+   bounds := pal.Bounds()
+   for y := top; y < top+rows; y++ {
+      for x := bounds.Min.X; x < bounds.Max.X; x++ {
+         seen[int(pal.ColorIndexAt(x, y))] = true
+      }
+   }
+   indices := make([]int, 0, len(seen))
+   for idx := range seen {
+      indices = append(indices, idx)
+   }
+   for i := 1; i < len(indices); i++ {
+      for j := i; j > 0 && indices[j-1] > indices[j]; j-- {
+         indices[j-1], indices[j] = indices[j], indices[j-1]
+      }
+   }
+   return indices
+}
+
+// writeSixelBand writes the sixel characters for a single color within one
+// six-row band, run-length compressing repeated characters as "!NC".
+func writeSixelBand(buf *bytes.Buffer, pal *image.Paletted, top, rows, width, minX, idx int) {
+   var run int
+   var last byte
+
+   flush := func() {
+      if run == 0 {
+         return
+      }
+      if run > 3 {
+         fmt.Fprintf(buf, "!%d%c", run, last)
+      } else {
+         for i := 0; i < run; i++ {
+            buf.WriteByte(last)
+         }
+      }
+      run = 0
+   }
+
+   for x := 0; x < width; x++ {
+      var bits byte
+      for y := 0; y < rows; y++ {
+         if int(pal.ColorIndexAt(minX+x, top+y)) == idx {
+            bits |= 1 << uint(y)
+         }
+      }
+      c := bits + 0x3F
+      if run > 0 && c == last {
+         run++
+         continue
+      }
+      flush()
+      last, run = c, 1
+   }
+   flush()
 }
 
 func showJaccuseAnimation() {
@@ -0,0 +1,223 @@
+package page
+
+import (
+   "bytes"
+   "image"
+   "image/color"
+   "image/gif"
+   "io"
+   "os"
+   "path/filepath"
+   "strings"
+   "testing"
+)
+
+func TestChunkSize(t *testing.T) {
+   tw := &termWriter{passthrough: passthroughNone}
+   if got := tw.chunkSize(4096); got != 4096 {
+      t.Errorf("chunkSize(4096) without passthrough = %d, want 4096", got)
+   }
+
+   tw.passthrough = passthroughScreen
+   if got := tw.chunkSize(4096); got != screenDCSLimit/2 {
+      t.Errorf("chunkSize(4096) under screen = %d, want %d", got, screenDCSLimit/2)
+   }
+   if got := tw.chunkSize(100); got != 100 {
+      t.Errorf("chunkSize(100) under screen should stay below the cap already = %d, want 100", got)
+   }
+}
+
+func TestFitsSingleSeq(t *testing.T) {
+   tw := &termWriter{passthrough: passthroughNone}
+   if !tw.fitsSingleSeq(10000) {
+      t.Error("fitsSingleSeq without passthrough should always be true")
+   }
+
+   tw.passthrough = passthroughScreen
+   if !tw.fitsSingleSeq(10) {
+      t.Error("a small sequence should fit under screen's DCS cap")
+   }
+   if tw.fitsSingleSeq(screenDCSLimit) {
+      t.Error("a sequence at the raw cap should not fit once envelope overhead is added")
+   }
+}
+
+func TestWriteSeqPassthroughWrapping(t *testing.T) {
+   var buf bytes.Buffer
+   tw := &termWriter{w: &buf, passthrough: passthroughTmux}
+   tw.writeSeq("\033]1337;abc\a")
+
+   want := "\033Ptmux;\033" + "\033\033]1337;abc\a" + "\033\\"
+   if got := buf.String(); got != want {
+      t.Errorf("writeSeq tmux wrapping = %q, want %q", got, want)
+   }
+
+   buf.Reset()
+   tw.passthrough = passthroughScreen
+   tw.writeSeq("\033]1337;abc\a")
+   want = "\033P" + "\033\033]1337;abc\a" + "\033\\"
+   if got := buf.String(); got != want {
+      t.Errorf("writeSeq screen wrapping = %q, want %q", got, want)
+   }
+
+   buf.Reset()
+   tw.passthrough = passthroughNone
+   tw.writeSeq("\033]1337;abc\a")
+   if got := buf.String(); got != "\033]1337;abc\a" {
+      t.Errorf("writeSeq without passthrough should write seq unchanged, got %q", got)
+   }
+}
+
+func TestWriteChunked(t *testing.T) {
+   var buf bytes.Buffer
+   tw := &termWriter{w: &buf, passthrough: passthroughNone}
+
+   var chunks []string
+   var firsts, mores []bool
+   writeChunked(tw, "abcdefgh", 3, func(chunk string, first, more bool) string {
+      chunks = append(chunks, chunk)
+      firsts = append(firsts, first)
+      mores = append(mores, more)
+      return chunk
+   })
+
+   wantChunks := []string{"abc", "def", "gh"}
+   if len(chunks) != len(wantChunks) {
+      t.Fatalf("got %d chunks %v, want %v", len(chunks), chunks, wantChunks)
+   }
+   for i, c := range wantChunks {
+      if chunks[i] != c {
+         t.Errorf("chunk %d = %q, want %q", i, chunks[i], c)
+      }
+   }
+   if !firsts[0] || firsts[1] || firsts[2] {
+      t.Errorf("first flags = %v, want [true false false]", firsts)
+   }
+   if !mores[0] || !mores[1] || mores[2] {
+      t.Errorf("more flags = %v, want [true true false]", mores)
+   }
+   if buf.String() != "abcdefgh" {
+      t.Errorf("writeChunked output = %q, want %q", buf.String(), "abcdefgh")
+   }
+}
+
+func TestUsedPaletteIndices(t *testing.T) {
+   pal := image.NewPaletted(image.Rect(0, 0, 3, 1), color.Palette{
+      color.RGBA{0, 0, 0, 255},
+      color.RGBA{255, 0, 0, 255},
+      color.RGBA{0, 255, 0, 255},
+   })
+   pal.SetColorIndex(0, 0, 0)
+   pal.SetColorIndex(1, 0, 2)
+   pal.SetColorIndex(2, 0, 0)
+
+   got := usedPaletteIndices(pal, 0, 1)
+   want := []int{0, 2}
+   if len(got) != len(want) {
+      t.Fatalf("usedPaletteIndices = %v, want %v", got, want)
+   }
+   for i := range want {
+      if got[i] != want[i] {
+         t.Errorf("usedPaletteIndices = %v, want %v", got, want)
+      }
+   }
+}
+
+func TestWriteSixelBandRunLengthEncoding(t *testing.T) {
+   pal := image.NewPaletted(image.Rect(0, 0, 5, 1), color.Palette{
+      color.RGBA{0, 0, 0, 255},
+   })
+
+   var buf bytes.Buffer
+   writeSixelBand(&buf, pal, 0, 1, 5, 0, 0)
+   // bits=1 (row 0 matches idx 0) -> char '@' (0x40), repeated 5x -> RLE'd.
+   if got, want := buf.String(), "!5@"; got != want {
+      t.Errorf("writeSixelBand RLE = %q, want %q", got, want)
+   }
+
+   buf.Reset()
+   writeSixelBand(&buf, pal, 0, 1, 2, 0, 0)
+   // A run of only 2 is below the RLE threshold and written out literally.
+   if got, want := buf.String(), "@@"; got != want {
+      t.Errorf("writeSixelBand short run = %q, want %q", got, want)
+   }
+}
+
+func TestEncodeSixel(t *testing.T) {
+   pal := color.Palette{
+      color.RGBA{0, 0, 0, 255},
+      color.RGBA{255, 255, 255, 255},
+   }
+   img := image.NewPaletted(image.Rect(0, 0, 2, 2), pal)
+   img.SetColorIndex(0, 0, 0)
+   img.SetColorIndex(1, 0, 1)
+   img.SetColorIndex(0, 1, 1)
+   img.SetColorIndex(1, 1, 0)
+
+   var gifBuf bytes.Buffer
+   if err := gif.Encode(&gifBuf, img, nil); err != nil {
+      t.Fatalf("gif.Encode: %v", err)
+   }
+
+   out, err := encodeSixel(&gifBuf)
+   if err != nil {
+      t.Fatalf("encodeSixel: %v", err)
+   }
+
+   s := string(out)
+   if !strings.HasPrefix(s, "\033Pq") {
+      t.Errorf("encodeSixel output missing DCS introducer: %q", s)
+   }
+   if !strings.HasSuffix(s, "\033\\") {
+      t.Errorf("encodeSixel output missing string terminator: %q", s)
+   }
+   if !strings.Contains(s, "#0;2;") || !strings.Contains(s, "#1;2;") {
+      t.Errorf("encodeSixel output missing palette registers for both colors: %q", s)
+   }
+}
+
+func TestResolveJaccuseAssetFallbackOrder(t *testing.T) {
+   dir := t.TempDir()
+
+   r := resolveJaccuseAsset(dir, JaccuseConfig{})
+   data, err := io.ReadAll(r)
+   if err != nil {
+      t.Fatalf("reading embedded default: %v", err)
+   }
+   if !bytes.Equal(data, defaultJaccuseGIF) {
+      t.Error("expected the embedded default when no asset is present anywhere")
+   }
+
+   assetsDir := filepath.Join(dir, "assets")
+   if err := os.MkdirAll(assetsDir, 0o755); err != nil {
+      t.Fatal(err)
+   }
+   if err := os.WriteFile(filepath.Join(assetsDir, "jaccuse.gif"), []byte("assets-gif"), 0o644); err != nil {
+      t.Fatal(err)
+   }
+   data, _ = io.ReadAll(resolveJaccuseAsset(dir, JaccuseConfig{}))
+   if string(data) != "assets-gif" {
+      t.Errorf("expected assets/jaccuse.gif contents, got %q", data)
+   }
+
+   staticDir := filepath.Join(dir, "static")
+   if err := os.MkdirAll(staticDir, 0o755); err != nil {
+      t.Fatal(err)
+   }
+   if err := os.WriteFile(filepath.Join(staticDir, "jaccuse.gif"), []byte("static-gif"), 0o644); err != nil {
+      t.Fatal(err)
+   }
+   data, _ = io.ReadAll(resolveJaccuseAsset(dir, JaccuseConfig{}))
+   if string(data) != "static-gif" {
+      t.Errorf("expected static/jaccuse.gif to win over assets/, got %q", data)
+   }
+
+   override := filepath.Join(dir, "custom.gif")
+   if err := os.WriteFile(override, []byte("override-gif"), 0o644); err != nil {
+      t.Fatal(err)
+   }
+   data, _ = io.ReadAll(resolveJaccuseAsset(dir, JaccuseConfig{AssetPath: override}))
+   if string(data) != "override-gif" {
+      t.Errorf("expected an explicit AssetPath to win over everything, got %q", data)
+   }
+}